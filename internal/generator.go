@@ -2,12 +2,15 @@ package internal
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,19 +18,45 @@ import (
 type Generator interface {
 	// Generate generates the given diagram.
 	Generate(diagram *Diagram) error
+	// Import reads one or more diagrams from src and generates each of them,
+	// returning the resulting Diagrams.
+	Import(src ImportSource) ([]*Diagram, error)
+	// GenerateStream behaves like Generate but reports progress on the
+	// returned channel as generation proceeds. The channel is closed once a
+	// Done or Failed event has been sent.
+	GenerateStream(diagram *Diagram) (<-chan Progress, error)
 	// CleanUp removes any diagrams that haven't used within the given duration.
 	CleanUp(duration time.Duration) error
+	// Close releases any resources (e.g. worker processes) held by the
+	// Generator. It is safe to call on a Generator that holds none.
+	Close() error
 }
 
 // NewGenerator returns a generator that can be used to generate diagrams.
-func NewGenerator(cache DiagramCache, mermaidCLIPath string, inPath string, outPath string, puppeteerConfigPath string) Generator {
+// Before returning, it replays the write-ahead log kept alongside outPath,
+// finishing or rolling back any operation a previous process left mid-flight.
+func NewGenerator(cache DiagramCache, mermaidCLIPath string, inPath string, outPath string, puppeteerConfigPath string) (Generator, error) {
+	walPath := filepath.Join(outPath, "wal.log")
+	records, err := replayWAL(walPath, cache)
+	if err != nil {
+		return nil, fmt.Errorf("could not replay wal [%s]: %w", walPath, err)
+	}
+
+	w, err := openWAL(walPath)
+	if err != nil {
+		return nil, err
+	}
+	w.records = records
+
 	return &cachingGenerator{
 		cache:               cache,
 		mermaidCLIPath:      mermaidCLIPath,
 		inPath:              inPath,
 		outPath:             outPath,
 		puppeteerConfigPath: puppeteerConfigPath,
-	}
+		wal:                 w,
+		runner:              execRunner{mermaidCLIPath: mermaidCLIPath, puppeteerConfigPath: puppeteerConfigPath},
+	}, nil
 }
 
 // cachingGenerator is an implementation of Generator.
@@ -37,6 +66,8 @@ type cachingGenerator struct {
 	inPath              string
 	outPath             string
 	puppeteerConfigPath string
+	wal                 *wal
+	runner              cliRunner
 }
 
 // Generate generates the given diagram.
@@ -62,19 +93,58 @@ func (c cachingGenerator) Generate(diagram *Diagram) error {
 	}
 
 	diagram.Touch()
-	if err := c.generate(diagram); err != nil {
+	return c.generateAndStore(diagram, nil, "")
+}
+
+// generateAndStore renders diagram, stores it in the cache, and brackets
+// both steps with WAL records so a crash partway through can be reconciled
+// by replayWAL. Generate and GenerateStream both funnel through this so
+// neither path can leave the WAL without a record of what it was doing.
+func (c cachingGenerator) generateAndStore(diagram *Diagram, progress chan<- Progress, shortID string) error {
+	id, err := diagram.ID()
+	if err != nil {
+		return fmt.Errorf("cannot get diagram ID: %w", err)
+	}
+	inPath := fmt.Sprintf("%s/%s.mmd", c.inPath, id)
+	outPath := fmt.Sprintf("%s/%s.%s", c.outPath, id, diagram.imgType)
+	if err := c.wal.append(walRecord{Op: opIntentGenerate, ID: id, InPath: inPath, OutPath: outPath}); err != nil {
+		return fmt.Errorf("wal.append failed: %w", err)
+	}
+
+	if err := c.generate(diagram, progress, shortID); err != nil {
 		return fmt.Errorf("cachingGenerater.generate failed: %w", err)
 	}
 	if err := c.cache.Store(diagram); err != nil {
 		return fmt.Errorf("cache.Store failed: %w", err)
 	}
+	if err := c.wal.append(walRecord{Op: opCommitStore, ID: id, InPath: inPath, OutPath: outPath}); err != nil {
+		return fmt.Errorf("wal.append failed: %w", err)
+	}
+	if err := c.wal.maybeSnapshot(c.cache); err != nil {
+		return fmt.Errorf("wal.maybeSnapshot failed: %w", err)
+	}
 	return nil
 }
 
+// cliRunner renders a single diagram already written to inPath into outPath.
+// If progress is non-nil, implementations should emit CLIStdout/CLIStderr
+// events tagged with shortID as output becomes available. format is the
+// output image type (e.g. "svg" or "png"), which always matches outPath's
+// extension; it's passed explicitly so implementations that don't exec a
+// CLI capable of sniffing outPath itself (e.g. poolRunner) can still select
+// the right renderer output format.
+type cliRunner interface {
+	run(id, inPath, outPath, format string, progress chan<- Progress, shortID string) error
+}
+
 // generate does the actual file generation.
 // generate 执行实际的文件生成操作
 // 它接收一个 Diagram 对象作为参数,生成对应的图表文件
-func (c cachingGenerator) generate(diagram *Diagram) error {
+//
+// If progress is non-nil, each line the mermaid CLI writes to stdout/stderr
+// is emitted as a CLIStdout/CLIStderr event tagged with shortID, instead of
+// being captured and logged as a single block.
+func (c cachingGenerator) generate(diagram *Diagram, progress chan<- Progress, shortID string) error {
 	// 获取图表的唯一标识符
 	id, err := diagram.ID()
 	if err != nil {
@@ -92,8 +162,26 @@ func (c cachingGenerator) generate(diagram *Diagram) error {
 		return fmt.Errorf("could not write to input file [%s]: %w", inPath, err)
 	}
 
+	if err := c.runner.run(id, inPath, outPath, diagram.imgType, progress, shortID); err != nil {
+		return err
+	}
+
+	// 设置图表的输出文件路径
+	diagram.Output = outPath
+
+	return nil
+}
+
+// execRunner is the default cliRunner: it exec's a fresh mermaid CLI process
+// per diagram.
+type execRunner struct {
+	mermaidCLIPath      string
+	puppeteerConfigPath string
+}
+
+func (r execRunner) run(id, inPath, outPath, format string, progress chan<- Progress, shortID string) error {
 	// 检查 mermaid CLI 可执行文件是否存在
-	_, err = os.Stat(c.mermaidCLIPath)
+	_, err := os.Stat(r.mermaidCLIPath)
 	if os.IsNotExist(err) {
 		return fmt.Errorf("mermaid executable does not exist: %w", err)
 	}
@@ -101,34 +189,81 @@ func (c cachingGenerator) generate(diagram *Diagram) error {
 		return fmt.Errorf("could not stat mermaid executable: %w", err)
 	}
 
+	// mmdc renders to a temp path in the same directory and we rename it
+	// into place atomically once it exits successfully, so that a crash
+	// mid-render can never leave a partial/corrupt file at outPath — its
+	// existence at outPath always implies a complete render.
+	tmpOutPath := outPath + ".tmp"
+
 	// 构造 mermaid CLI 的命令行参数
 	args := []string{
 		"-i", inPath,
-		"-o", outPath,
+		"-o", tmpOutPath,
+		// tmpOutPath's ".tmp" extension names no image format, so pass it.
+		"-e", format,
 	}
 	// 如果配置了 puppeteer 配置文件路径,则添加相应参数
-	if c.puppeteerConfigPath != "" {
-		args = append(args, "-p", c.puppeteerConfigPath)
+	if r.puppeteerConfigPath != "" {
+		args = append(args, "-p", r.puppeteerConfigPath)
+	}
+
+	// 创建 mermaid CLI 命令,通过管道逐行读取输出而不是一次性缓冲
+	cmd := exec.Command(r.mermaidCLIPath, args...)
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("could not attach to mermaid stdout: %w", err)
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("could not attach to mermaid stderr: %w", err)
 	}
 
-	// 创建并执行 mermaid CLI 命令
-	cmd := exec.Command(c.mermaidCLIPath, args...)
-	var stdOut bytes.Buffer
-	var stdErr bytes.Buffer
-	cmd.Stdout = bufio.NewWriter(&stdOut)
-	cmd.Stderr = bufio.NewWriter(&stdErr)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed when executing mermaid: %w: %s: %s", err, string(stdOut.Bytes()), string(stdErr.Bytes()))
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start mermaid: %w", err)
 	}
-	// 记录生成结果的日志
-	log.Printf("Generated: %s: %s: %s", id, string(stdOut.Bytes()), string(stdErr.Bytes()))
 
-	// 设置图表的输出文件路径
-	diagram.Output = outPath
+	var wg sync.WaitGroup
+	var stdoutLines, stderrLines []string
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		stdoutLines = scanLines(stdoutPipe, progress, shortID, CLIStdout)
+	}()
+	go func() {
+		defer wg.Done()
+		stderrLines = scanLines(stderrPipe, progress, shortID, CLIStderr)
+	}()
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		os.Remove(tmpOutPath)
+		return fmt.Errorf("failed when executing mermaid: %w: %s: %s", err, strings.Join(stdoutLines, "\n"), strings.Join(stderrLines, "\n"))
+	}
+	if err := os.Rename(tmpOutPath, outPath); err != nil {
+		return fmt.Errorf("could not move rendered output into place [%s]: %w", outPath, err)
+	}
+	// 记录生成结果的日志
+	log.Printf("Generated: %s: %s: %s", id, strings.Join(stdoutLines, "\n"), strings.Join(stderrLines, "\n"))
 
 	return nil
 }
 
+// scanLines reads r line by line, emitting a Progress event of the given
+// kind for each line when progress is non-nil, and always returns the lines
+// read so callers can still log or report the full output on completion.
+func scanLines(r io.Reader, progress chan<- Progress, shortID string, kind ProgressKind) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+		if progress != nil {
+			progress <- Progress{ID: shortID, Kind: kind, Line: line}
+		}
+	}
+	return lines
+}
+
 // CleanUp removes any diagrams that haven't used within the given duration.
 func (c cachingGenerator) CleanUp(duration time.Duration) error {
 	log.Printf("Running cleanup")
@@ -146,6 +281,12 @@ func (c cachingGenerator) CleanUp(duration time.Duration) error {
 	return nil
 }
 
+// Close releases the write-ahead log. cachingGenerator holds no other
+// resources that need a graceful shutdown.
+func (c cachingGenerator) Close() error {
+	return c.wal.close()
+}
+
 // delete removes any diagrams that haven't used within the given duration.
 func (c cachingGenerator) delete(diagram *Diagram) error {
 	id, err := diagram.ID()
@@ -158,6 +299,10 @@ func (c cachingGenerator) delete(diagram *Diagram) error {
 	inPath := fmt.Sprintf("%s/%s.mmd", c.inPath, id)
 	outPath := fmt.Sprintf("%s/%s.svg", c.outPath, id)
 
+	if err := c.wal.append(walRecord{Op: opIntentDelete, ID: id, InPath: inPath, OutPath: outPath}); err != nil {
+		return fmt.Errorf("wal.append failed: %w", err)
+	}
+
 	if err := os.Remove(inPath); err != nil {
 		return fmt.Errorf("could not delete diagram input: %w", err)
 	}
@@ -167,6 +312,12 @@ func (c cachingGenerator) delete(diagram *Diagram) error {
 	if err := c.cache.Delete(diagram); err != nil {
 		return fmt.Errorf("could not remove diagram from cache: %w", err)
 	}
+	if err := c.wal.append(walRecord{Op: opCommitDelete, ID: id, InPath: inPath, OutPath: outPath}); err != nil {
+		return fmt.Errorf("wal.append failed: %w", err)
+	}
+	if err := c.wal.maybeSnapshot(c.cache); err != nil {
+		return fmt.Errorf("wal.maybeSnapshot failed: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ImportHandler handles bulk diagram import requests. A request may either
+// supply a `url` query parameter pointing at a .mmd file or a .tar/.tar.gz
+// archive, or stream a tarball directly as the request body (e.g.
+// `POST /import` with `Content-Type: application/x-tar`).
+func ImportHandler(gen Generator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		src := ImportSource{ImgType: r.URL.Query().Get("type")}
+		if u := r.URL.Query().Get("url"); u != "" {
+			src.URL = u
+		} else {
+			src.Reader = http.MaxBytesReader(w, r.Body, maxImportResponseBytes)
+		}
+
+		diagrams, err := gen.Import(src)
+		if err != nil {
+			log.Printf("import failed: %s", err)
+			http.Error(w, fmt.Sprintf("import failed: %s", err), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(diagrams); err != nil {
+			log.Printf("could not encode import response: %s", err)
+		}
+	}
+}
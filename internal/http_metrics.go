@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// MetricsHandler reports gen's current load (worker count, busy workers,
+// queue depth) as JSON, for scraping into a dashboard or Prometheus exporter.
+// It responds 404 if gen doesn't implement MetricsProvider (e.g. a plain
+// execRunner-backed Generator, which has no pool to report on).
+func MetricsHandler(gen Generator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := gen.(MetricsProvider)
+		if !ok {
+			http.Error(w, "generator does not expose metrics", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(provider.Metrics()); err != nil {
+			log.Printf("could not encode metrics response: %s", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeGenerator is a minimal Generator stub for exercising handlers without
+// a real cache/WAL/CLI pipeline.
+type fakeGenerator struct{}
+
+func (fakeGenerator) Generate(diagram *Diagram) error                          { return nil }
+func (fakeGenerator) Import(src ImportSource) ([]*Diagram, error)              { return nil, nil }
+func (fakeGenerator) GenerateStream(diagram *Diagram) (<-chan Progress, error) { return nil, nil }
+func (fakeGenerator) CleanUp(d time.Duration) error                            { return nil }
+func (fakeGenerator) Close() error                                             { return nil }
+
+// fakeMetricsGenerator additionally implements MetricsProvider, the way
+// pooledGenerator does.
+type fakeMetricsGenerator struct {
+	fakeGenerator
+	metrics PoolMetrics
+}
+
+func (g fakeMetricsGenerator) Metrics() PoolMetrics { return g.metrics }
+
+func TestMetricsHandlerReturns404WhenGeneratorHasNoMetrics(t *testing.T) {
+	handler := MetricsHandler(fakeGenerator{})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a generator without metrics, got %d", rec.Code)
+	}
+}
+
+func TestMetricsHandlerReturnsPoolMetricsAsJSON(t *testing.T) {
+	gen := fakeMetricsGenerator{metrics: PoolMetrics{Workers: 4, BusyWorkers: 2, QueueDepth: 3}}
+	handler := MetricsHandler(gen)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var got PoolMetrics
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("could not decode metrics response: %s", err)
+	}
+	if got != gen.metrics {
+		t.Fatalf("metrics response = %+v, want %+v", got, gen.metrics)
+	}
+}
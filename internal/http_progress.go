@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// GenerateStreamHandler generates the diagram built by newDiagram and streams
+// its progress back to the client as Server-Sent Events, one `event: <kind>`
+// per Progress, so a client can watch a live feed instead of waiting for a
+// single opaque response.
+func GenerateStreamHandler(gen Generator, newDiagram func(*http.Request) (*Diagram, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		diagram, err := newDiagram(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid diagram: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		progress, err := gen.GenerateStream(diagram)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not start generation: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		for p := range progress {
+			// Encode as JSON so the payload is always a single line; CLI
+			// output routinely contains embedded newlines, which would
+			// otherwise be parsed as new SSE fields/events.
+			data, err := json.Marshal(p.event())
+			if err != nil {
+				log.Printf("could not encode progress event: %s", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", p.Kind, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// maxImportResponseBytes caps how much of a fetched URL's body (or a
+// directly-streamed tarball) Import will read, so a huge or maliciously
+// compressed response can't exhaust memory.
+const maxImportResponseBytes = 200 << 20 // 200MiB
+
+// maxTarEntryBytes caps how large a single .mmd tar entry Import will read.
+const maxTarEntryBytes = 20 << 20 // 20MiB
+
+// maxTarTotalBytes caps the total decompressed size read across every .mmd
+// entry in an archive, so a small gzip payload that unpacks into many
+// entries just under maxTarEntryBytes (a decompression bomb) can't exhaust
+// memory even though each individual entry passes the per-entry check.
+const maxTarTotalBytes = 200 << 20 // 200MiB
+
+// maxTarEntryCount caps how many .mmd entries a single archive may contain.
+const maxTarEntryCount = 10000
+
+// ImportSource describes where Import should read diagrams from, modeled on
+// Docker's CmdImport: either a URL to a single .mmd file, a URL to a
+// .tar/.tar.gz archive containing many .mmd files, or a raw tarball stream
+// (e.g. piped in on stdin or an HTTP request body).
+type ImportSource struct {
+	// URL, if set, is fetched and imported. It may point at a single .mmd
+	// file or at a .tar/.tar.gz archive.
+	URL string
+	// Reader, if URL is empty, is read as a tarball.
+	Reader io.Reader
+	// ImgType is the output image type (e.g. "svg" or "png") applied to
+	// every diagram read from this source.
+	ImgType string
+}
+
+// Import reads one or more diagrams from src, fans them through the
+// existing cache/generate pipeline, and returns the resulting Diagrams.
+func (c cachingGenerator) Import(src ImportSource) ([]*Diagram, error) {
+	imgType := src.ImgType
+	if imgType == "" {
+		imgType = "svg"
+	}
+
+	r := src.Reader
+	if src.URL != "" {
+		u, err := validateImportURL(src.URL)
+		if err != nil {
+			return nil, fmt.Errorf("refusing to fetch import url [%s]: %w", src.URL, err)
+		}
+
+		resp, err := importHTTPClient.Get(src.URL)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch import url [%s]: %w", src.URL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not fetch import url [%s]: unexpected status %s", src.URL, resp.Status)
+		}
+
+		body := io.LimitReader(resp.Body, maxImportResponseBytes+1)
+
+		// Check the URL's path, not the raw URL, so a query string or
+		// fragment (e.g. "diagram.mmd?raw=1") doesn't hide a single-file
+		// import behind the tarball path, and so the label doesn't end up
+		// with the query string baked into it.
+		if strings.HasSuffix(u.Path, ".mmd") {
+			description, err := ioutil.ReadAll(body)
+			if err != nil {
+				return nil, fmt.Errorf("could not read imported diagram [%s]: %w", src.URL, err)
+			}
+			if len(description) > maxImportResponseBytes {
+				return nil, fmt.Errorf("import url [%s] exceeds max size of %d bytes", src.URL, maxImportResponseBytes)
+			}
+			return c.importAll([]tarEntry{{name: path.Base(u.Path), description: description}}, imgType)
+		}
+
+		r = body
+	}
+
+	if r == nil {
+		return nil, fmt.Errorf("import source has neither a url nor a reader")
+	}
+
+	entries, err := readTarEntries(io.LimitReader(r, maxImportResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("could not read import archive: %w", err)
+	}
+	return c.importAll(entries, imgType)
+}
+
+// tarEntry is a single .mmd file read from an import source, in the order
+// it was encountered.
+type tarEntry struct {
+	name        string
+	description []byte
+}
+
+// importAll generates a Diagram, labelled with its entry name, for each
+// entry, in archive order.
+func (c cachingGenerator) importAll(entries []tarEntry, imgType string) ([]*Diagram, error) {
+	diagrams := make([]*Diagram, 0, len(entries))
+	for _, entry := range entries {
+		diagram := NewDiagram(entry.description, imgType)
+		diagram.Label = strings.TrimSuffix(entry.name, path.Ext(entry.name))
+
+		if err := c.Generate(diagram); err != nil {
+			return diagrams, fmt.Errorf("could not generate imported diagram [%s]: %w", entry.name, err)
+		}
+		diagrams = append(diagrams, diagram)
+	}
+	return diagrams, nil
+}
+
+// readTarEntries walks a tarball (optionally gzip-compressed) and returns
+// the contents of every .mmd entry, in the order they appear in the archive.
+func readTarEntries(r io.Reader) ([]tarEntry, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not inspect archive: %w", err)
+	}
+
+	var tr *tar.Reader
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("could not open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		tr = tar.NewReader(gz)
+	} else {
+		tr = tar.NewReader(buffered)
+	}
+
+	var entries []tarEntry
+	var totalBytes int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read tar entry: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".mmd") {
+			continue
+		}
+		if len(entries) >= maxTarEntryCount {
+			return nil, fmt.Errorf("import archive exceeds max entry count of %d", maxTarEntryCount)
+		}
+		contents, err := ioutil.ReadAll(io.LimitReader(tr, maxTarEntryBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("could not read tar entry [%s]: %w", hdr.Name, err)
+		}
+		if len(contents) > maxTarEntryBytes {
+			return nil, fmt.Errorf("tar entry [%s] exceeds max size of %d bytes", hdr.Name, maxTarEntryBytes)
+		}
+		totalBytes += int64(len(contents))
+		if totalBytes > maxTarTotalBytes {
+			return nil, fmt.Errorf("import archive exceeds max total size of %d bytes", maxTarTotalBytes)
+		}
+		entries = append(entries, tarEntry{name: hdr.Name, description: contents})
+	}
+	return entries, nil
+}
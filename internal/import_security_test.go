@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"net"
+	"testing"
+)
+
+func TestValidateImportURLRejectsUnsupportedSchemes(t *testing.T) {
+	cases := []string{
+		"ftp://example.com/diagram.mmd",
+		"file:///etc/passwd",
+		"not-a-url",
+		"http://",
+	}
+	for _, raw := range cases {
+		if _, err := validateImportURL(raw); err == nil {
+			t.Errorf("validateImportURL(%q): expected an error, got nil", raw)
+		}
+	}
+}
+
+func TestValidateImportURLAcceptsPlainHTTP(t *testing.T) {
+	u, err := validateImportURL("https://example.com/diagram.mmd")
+	if err != nil {
+		t.Fatalf("validateImportURL: unexpected error: %s", err)
+	}
+	if u.Hostname() != "example.com" {
+		t.Fatalf("expected hostname example.com, got %s", u.Hostname())
+	}
+}
+
+func TestIsDisallowedImportIP(t *testing.T) {
+	cases := []struct {
+		ip    string
+		bad   bool
+		label string
+	}{
+		{"127.0.0.1", true, "loopback"},
+		{"169.254.169.254", true, "link-local (cloud metadata)"},
+		{"10.0.0.1", true, "private"},
+		{"192.168.1.1", true, "private"},
+		{"0.0.0.0", true, "unspecified"},
+		{"224.0.0.1", true, "multicast"},
+		{"::1", true, "loopback v6"},
+		{"93.184.216.34", false, "public"},
+		{"8.8.8.8", false, "public"},
+	}
+	for _, c := range cases {
+		ip := net.ParseIP(c.ip)
+		if ip == nil {
+			t.Fatalf("test fixture has an invalid IP: %s", c.ip)
+		}
+		if got := isDisallowedImportIP(ip); got != c.bad {
+			t.Errorf("isDisallowedImportIP(%s) [%s]: got %v, want %v", c.ip, c.label, got, c.bad)
+		}
+	}
+}
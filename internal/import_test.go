@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// buildTar writes name/contents pairs as a tar archive and returns its bytes.
+func buildTar(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, contents := range entries {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("could not write tar header for %s: %s", name, err)
+		}
+		if _, err := tw.Write(contents); err != nil {
+			t.Fatalf("could not write tar contents for %s: %s", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar writer: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadTarEntriesReturnsEachMmdFile(t *testing.T) {
+	raw := buildTar(t, map[string][]byte{
+		"a.mmd":  []byte("graph TD; A-->B;"),
+		"b.mmd":  []byte("graph TD; B-->C;"),
+		"readme": []byte("not a diagram"),
+	})
+
+	entries, err := readTarEntries(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("readTarEntries: unexpected error: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 .mmd entries, got %d", len(entries))
+	}
+}
+
+func TestReadTarEntriesRejectsOversizedEntry(t *testing.T) {
+	raw := buildTar(t, map[string][]byte{
+		"big.mmd": bytes.Repeat([]byte("x"), maxTarEntryBytes+1),
+	})
+
+	if _, err := readTarEntries(bytes.NewReader(raw)); err == nil {
+		t.Fatal("expected readTarEntries to reject an entry over maxTarEntryBytes")
+	}
+}
+
+func TestReadTarEntriesRejectsTooManyEntries(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < maxTarEntryCount+1; i++ {
+		name := fmt.Sprintf("%d.mmd", i)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 0}); err != nil {
+			t.Fatalf("could not write tar header: %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar writer: %s", err)
+	}
+
+	if _, err := readTarEntries(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("expected readTarEntries to reject an archive over maxTarEntryCount")
+	}
+}
+
+func TestReadTarEntriesRejectsOversizedAggregateTotal(t *testing.T) {
+	// Each entry is individually small enough to pass the per-entry check,
+	// but there are enough of them to blow past maxTarTotalBytes.
+	entrySize := 1 << 20 // 1MiB
+	count := maxTarTotalBytes/entrySize + 2
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	contents := bytes.Repeat([]byte("x"), entrySize)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%d.mmd", i)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}); err != nil {
+			t.Fatalf("could not write tar header: %s", err)
+		}
+		if _, err := tw.Write(contents); err != nil {
+			t.Fatalf("could not write tar contents: %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("could not close tar writer: %s", err)
+	}
+
+	if _, err := readTarEntries(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("expected readTarEntries to reject an archive over maxTarTotalBytes in aggregate")
+	}
+}
@@ -0,0 +1,322 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queueCapacityPerWorker sizes the buffered jobs channel relative to the
+// pool's worker count, so Import-style bursts can queue up instead of every
+// caller beyond the worker count blocking synchronously, while still
+// applying real backpressure once the queue fills up.
+const queueCapacityPerWorker = 4
+
+// workerJob is sent to a worker's stdin as a single line of JSON.
+type workerJob struct {
+	ID              string `json:"id"`
+	InPath          string `json:"inPath"`
+	OutPath         string `json:"outPath"`
+	Format          string `json:"format"`
+	PuppeteerConfig string `json:"puppeteerConfig,omitempty"`
+}
+
+// workerResult is read back from a worker's stdout as a single line of JSON.
+type workerResult struct {
+	ID     string `json:"id"`
+	OK     bool   `json:"ok"`
+	Stderr string `json:"stderr"`
+}
+
+// request pairs a workerJob with the channel its result should be delivered
+// on, so multiple callers can share the same worker pool.
+type request struct {
+	job    workerJob
+	result chan<- workerResult
+}
+
+// workerPool is a bounded set of long-lived node processes, each running a
+// wrapper script that keeps a single Puppeteer browser open and renders jobs
+// read from stdin, avoiding the 1-3s Puppeteer startup cost on every call.
+type workerPool struct {
+	nodePath   string
+	scriptPath string
+	size       int
+
+	jobs chan request
+	busy int32 // atomic count of workers currently rendering a job
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// PoolMetrics is a snapshot of a worker pool's load, for callers that want
+// to expose queue-depth/worker-busy gauges (e.g. to Prometheus).
+type PoolMetrics struct {
+	// Workers is the configured size of the pool.
+	Workers int
+	// BusyWorkers is how many workers are currently rendering a job.
+	BusyWorkers int
+	// QueueDepth is how many jobs are buffered waiting for a free worker.
+	QueueDepth int
+}
+
+// MetricsProvider is implemented by Generators that can report load metrics,
+// currently only the worker-pool-backed Generator returned by
+// NewGeneratorPool. MetricsHandler type-asserts against this interface
+// rather than adding Metrics to Generator itself, since a plain
+// execRunner-backed Generator has no pool to report on.
+type MetricsProvider interface {
+	Metrics() PoolMetrics
+}
+
+// Metrics returns a snapshot of the pool's current load.
+func (p *workerPool) Metrics() PoolMetrics {
+	return PoolMetrics{
+		Workers:     p.size,
+		BusyWorkers: int(atomic.LoadInt32(&p.busy)),
+		QueueDepth:  len(p.jobs),
+	}
+}
+
+// NewGeneratorPool returns a Generator backed by a pool of size long-lived
+// mermaid-cli worker processes instead of spawning a fresh process (and a
+// fresh Puppeteer browser) per diagram. nodePath and scriptPath locate the
+// node runtime and the worker wrapper script shipped at scripts/mmdc-worker.js.
+// The write-ahead log and cache wiring come from NewGenerator (with no mermaid
+// CLI path); rendering goes through the pool, which passes puppeteerConfigPath
+// along with every job.
+func NewGeneratorPool(size int, cache DiagramCache, nodePath string, scriptPath string, inPath string, outPath string, puppeteerConfigPath string) (Generator, error) {
+	base, err := NewGenerator(cache, "", inPath, outPath, puppeteerConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize generator pool base: %w", err)
+	}
+	cg, ok := base.(*cachingGenerator)
+	if !ok {
+		return nil, fmt.Errorf("unexpected generator implementation %T", base)
+	}
+
+	pool := &workerPool{
+		nodePath:   nodePath,
+		scriptPath: scriptPath,
+		size:       size,
+		jobs:       make(chan request, size*queueCapacityPerWorker),
+		closed:     make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		pool.wg.Add(1)
+		go pool.runWorker()
+	}
+
+	cg.runner = poolRunner{pool: pool, puppeteerConfigPath: puppeteerConfigPath}
+
+	return &pooledGenerator{cachingGenerator: *cg, pool: pool}, nil
+}
+
+// spawnBackoffMin and spawnBackoffMax bound the delay between consecutive
+// spawn retries, so a persistently misconfigured nodePath/scriptPath backs
+// off instead of pinning a CPU in a tight restart loop.
+const (
+	spawnBackoffMin = 500 * time.Millisecond
+	spawnBackoffMax = 30 * time.Second
+)
+
+// runWorker owns one node subprocess for the lifetime of the pool, restarting
+// it if it crashes or its pipes break. Repeated spawn failures back off
+// exponentially up to spawnBackoffMax; the backoff resets once a spawn
+// succeeds.
+func (p *workerPool) runWorker() {
+	defer p.wg.Done()
+	backoff := spawnBackoffMin
+	for {
+		select {
+		case <-p.closed:
+			return
+		default:
+		}
+
+		worker, stdout, err := p.spawn()
+		if err != nil {
+			log.Printf("could not spawn mmdc worker: %s (retrying in %s)", err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-p.closed:
+				return
+			}
+			if backoff *= 2; backoff > spawnBackoffMax {
+				backoff = spawnBackoffMax
+			}
+			continue
+		}
+		backoff = spawnBackoffMin
+
+		p.serve(worker, stdout)
+	}
+}
+
+type spawnedWorker struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func (p *workerPool) spawn() (*spawnedWorker, *bufio.Scanner, error) {
+	cmd := exec.Command(p.nodePath, p.scriptPath)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not attach to worker stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not attach to worker stdout: %w", err)
+	}
+	cmd.Stderr = log.Writer()
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("could not start worker: %w", err)
+	}
+	return &spawnedWorker{cmd: cmd, stdin: stdin}, bufio.NewScanner(stdout), nil
+}
+
+// serve feeds jobs to worker until a job fails to be written/read, in which
+// case it reports that job's failure and returns so the caller can respawn.
+func (p *workerPool) serve(worker *spawnedWorker, stdout *bufio.Scanner) {
+	defer worker.cmd.Wait()
+	defer worker.stdin.Close()
+
+	for {
+		select {
+		case <-p.closed:
+			// Finish the jobs already queued before exiting, so their
+			// callers aren't left waiting on a result that never comes.
+			for {
+				select {
+				case req := <-p.jobs:
+					atomic.AddInt32(&p.busy, 1)
+					healthy := p.serveOne(worker, stdout, req)
+					atomic.AddInt32(&p.busy, -1)
+					if !healthy {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case req := <-p.jobs:
+			atomic.AddInt32(&p.busy, 1)
+			healthy := p.serveOne(worker, stdout, req)
+			atomic.AddInt32(&p.busy, -1)
+			if !healthy {
+				return
+			}
+		}
+	}
+}
+
+// serveOne sends one job to worker and waits for its result, reporting
+// whether the worker is still usable for subsequent jobs.
+func (p *workerPool) serveOne(worker *spawnedWorker, stdout *bufio.Scanner, req request) bool {
+	line, err := json.Marshal(req.job)
+	if err != nil {
+		req.result <- workerResult{ID: req.job.ID, OK: false, Stderr: fmt.Sprintf("could not marshal job: %s", err)}
+		return true
+	}
+	if _, err := worker.stdin.Write(append(line, '\n')); err != nil {
+		req.result <- workerResult{ID: req.job.ID, OK: false, Stderr: fmt.Sprintf("worker write failed: %s", err)}
+		return false
+	}
+	if !stdout.Scan() {
+		req.result <- workerResult{ID: req.job.ID, OK: false, Stderr: "worker exited without a result"}
+		return false
+	}
+	var res workerResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		req.result <- workerResult{ID: req.job.ID, OK: false, Stderr: fmt.Sprintf("could not parse worker result: %s", err)}
+		return false
+	}
+	req.result <- res
+	return true
+}
+
+// dispatch sends job to the pool and blocks until a worker returns a result.
+// The jobs channel is buffered so bursts can queue instead of every caller
+// beyond the worker count blocking immediately, but once the queue fills up
+// this still blocks the caller, providing backpressure.
+func (p *workerPool) dispatch(job workerJob) (workerResult, error) {
+	result := make(chan workerResult, 1)
+	select {
+	case p.jobs <- request{job: job, result: result}:
+	case <-p.closed:
+		return workerResult{}, fmt.Errorf("worker pool is closed")
+	}
+	return <-result, nil
+}
+
+// Close stops dispatch from accepting new jobs, lets the workers finish the
+// jobs already queued, and waits for their subprocesses to exit.
+func (p *workerPool) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	p.wg.Wait()
+	return nil
+}
+
+// poolRunner is the cliRunner that dispatches rendering work to a workerPool
+// instead of exec'ing a fresh mmdc process.
+type poolRunner struct {
+	pool                *workerPool
+	puppeteerConfigPath string
+}
+
+func (r poolRunner) run(id, inPath, outPath, format string, progress chan<- Progress, shortID string) error {
+	if progress != nil {
+		progress <- Progress{ID: shortID, Kind: Started}
+	}
+
+	res, err := r.pool.dispatch(workerJob{
+		ID:              id,
+		InPath:          inPath,
+		OutPath:         outPath,
+		Format:          format,
+		PuppeteerConfig: r.puppeteerConfigPath,
+	})
+	if err != nil {
+		return fmt.Errorf("could not dispatch to worker pool: %w", err)
+	}
+	if progress != nil && res.Stderr != "" {
+		progress <- Progress{ID: shortID, Kind: CLIStderr, Line: res.Stderr}
+	}
+	if !res.OK {
+		return fmt.Errorf("worker failed to render [%s]: %s", id, res.Stderr)
+	}
+
+	log.Printf("Generated: %s: %s", id, res.Stderr)
+	return nil
+}
+
+// pooledGenerator is a Generator that renders through a workerPool. It
+// embeds cachingGenerator for the cache/WAL pipeline, which already
+// delegates rendering to whatever cliRunner is installed, and additionally
+// drains the pool on Close.
+type pooledGenerator struct {
+	cachingGenerator
+	pool *workerPool
+}
+
+// Close drains the worker pool before releasing the write-ahead log.
+func (p *pooledGenerator) Close() error {
+	if err := p.pool.Close(); err != nil {
+		return fmt.Errorf("could not close worker pool: %w", err)
+	}
+	return p.cachingGenerator.Close()
+}
+
+// Metrics returns a snapshot of the underlying worker pool's queue depth
+// and busy-worker count.
+func (p *pooledGenerator) Metrics() PoolMetrics {
+	return p.pool.Metrics()
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolMetricsReflectsLoadAndQueueDepth(t *testing.T) {
+	p := &workerPool{size: 3, jobs: make(chan request, 5)}
+	p.jobs <- request{job: workerJob{ID: "a"}, result: make(chan workerResult, 1)}
+	p.jobs <- request{job: workerJob{ID: "b"}, result: make(chan workerResult, 1)}
+	atomic.StoreInt32(&p.busy, 1)
+
+	m := p.Metrics()
+	if m.Workers != 3 || m.BusyWorkers != 1 || m.QueueDepth != 2 {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+}
+
+func TestDispatchQueuesAndReturnsWorkerResult(t *testing.T) {
+	p := &workerPool{jobs: make(chan request, 1), closed: make(chan struct{})}
+	go func() {
+		req := <-p.jobs
+		req.result <- workerResult{ID: req.job.ID, OK: true}
+	}()
+
+	res, err := p.dispatch(workerJob{ID: "abc"})
+	if err != nil {
+		t.Fatalf("dispatch: unexpected error: %s", err)
+	}
+	if !res.OK || res.ID != "abc" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestDispatchBlocksOnceQueueIsFull(t *testing.T) {
+	p := &workerPool{jobs: make(chan request, 1), closed: make(chan struct{})}
+	// Fill the only queue slot so a second dispatch has to block for
+	// backpressure instead of enqueuing immediately.
+	p.jobs <- request{job: workerJob{ID: "first"}, result: make(chan workerResult, 1)}
+
+	done := make(chan struct{})
+	go func() {
+		p.dispatch(workerJob{ID: "second"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("dispatch should have blocked while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Draining the queued job frees a slot, so the blocked dispatch can
+	// enqueue and a waiting "worker" can answer both jobs.
+	first := <-p.jobs
+	first.result <- workerResult{ID: "first", OK: true}
+	second := <-p.jobs
+	second.result <- workerResult{ID: "second", OK: true}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch did not unblock after the queue drained")
+	}
+}
+
+func TestDispatchFailsOncePoolIsClosed(t *testing.T) {
+	p := &workerPool{jobs: make(chan request), closed: make(chan struct{})}
+	close(p.closed)
+
+	if _, err := p.dispatch(workerJob{ID: "x"}); err == nil {
+		t.Fatal("expected dispatch to fail once the pool is closed")
+	}
+}
@@ -0,0 +1,156 @@
+package internal
+
+import "fmt"
+
+// ProgressKind identifies the stage a Progress event was emitted from.
+type ProgressKind int
+
+const (
+	// Queued is emitted once, as soon as GenerateStream is called.
+	Queued ProgressKind = iota
+	// Started is emitted when the mermaid CLI subprocess is launched.
+	Started
+	// CLIStdout is emitted for each line the mermaid CLI writes to stdout.
+	CLIStdout
+	// CLIStderr is emitted for each line the mermaid CLI writes to stderr.
+	CLIStderr
+	// Cached is emitted when the diagram was already present in the cache.
+	Cached
+	// Stored is emitted once the diagram has been written to the cache.
+	Stored
+	// Done is emitted as the final event on success.
+	Done
+	// Failed is emitted as the final event on failure; Err holds the cause.
+	Failed
+)
+
+func (k ProgressKind) String() string {
+	switch k {
+	case Queued:
+		return "queued"
+	case Started:
+		return "started"
+	case CLIStdout:
+		return "cli-stdout"
+	case CLIStderr:
+		return "cli-stderr"
+	case Cached:
+		return "cached"
+	case Stored:
+		return "stored"
+	case Done:
+		return "done"
+	case Failed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Progress is a single event emitted while a diagram is being generated.
+type Progress struct {
+	// ID is the diagram ID, truncated to 12 characters in the style of
+	// Docker's TruncateID, for correlating events with a diagram.
+	ID   string
+	Kind ProgressKind
+	// Line holds the CLI output line for CLIStdout/CLIStderr events.
+	Line string
+	// Err holds the failure cause for Failed events.
+	Err error
+}
+
+func (p Progress) String() string {
+	switch p.Kind {
+	case CLIStdout, CLIStderr:
+		return fmt.Sprintf("%s: %s: %s", p.ID, p.Kind, p.Line)
+	case Failed:
+		return fmt.Sprintf("%s: %s: %s", p.ID, p.Kind, p.Err)
+	default:
+		return fmt.Sprintf("%s: %s", p.ID, p.Kind)
+	}
+}
+
+// progressEvent is the JSON-serializable form of a Progress, used to encode
+// it as a single-line SSE payload. Progress itself isn't used directly
+// because error doesn't marshal to JSON, and because CLI output routinely
+// contains embedded newlines that would otherwise break SSE framing.
+type progressEvent struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Line string `json:"line,omitempty"`
+	Err  string `json:"err,omitempty"`
+}
+
+// event returns p as a progressEvent suitable for JSON-encoding into a
+// single SSE data line.
+func (p Progress) event() progressEvent {
+	ev := progressEvent{ID: p.ID, Kind: p.Kind.String(), Line: p.Line}
+	if p.Err != nil {
+		ev.Err = p.Err.Error()
+	}
+	return ev
+}
+
+// shortIDLen matches Docker's TruncateID convention for correlating log
+// lines with an object without printing the full ID.
+const shortIDLen = 12
+
+// truncateID returns the first 12 characters of id, in the style of
+// Docker's TruncateID.
+func truncateID(id string) string {
+	if len(id) > shortIDLen {
+		return id[:shortIDLen]
+	}
+	return id
+}
+
+// GenerateStream behaves like Generate but reports progress on the returned
+// channel as generation proceeds. The channel is closed once a Done or
+// Failed event has been sent.
+func (c cachingGenerator) GenerateStream(diagram *Diagram) (<-chan Progress, error) {
+	id, err := diagram.ID()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get diagram ID: %w", err)
+	}
+	shortID := truncateID(id)
+
+	progress := make(chan Progress, 16)
+	go func() {
+		defer close(progress)
+		progress <- Progress{ID: shortID, Kind: Queued}
+
+		has, err := c.cache.Has(diagram)
+		if err != nil {
+			progress <- Progress{ID: shortID, Kind: Failed, Err: fmt.Errorf("cache.Has failed: %w", err)}
+			return
+		}
+		if has {
+			cached, err := c.cache.Get(diagram)
+			if err != nil {
+				progress <- Progress{ID: shortID, Kind: Failed, Err: fmt.Errorf("cache.Get failed: %w", err)}
+				return
+			}
+			*diagram = *cached
+
+			diagram.Touch()
+			if err := c.cache.Store(diagram); err != nil {
+				progress <- Progress{ID: shortID, Kind: Failed, Err: fmt.Errorf("cache.Store failed: %w", err)}
+				return
+			}
+			progress <- Progress{ID: shortID, Kind: Cached}
+			progress <- Progress{ID: shortID, Kind: Done}
+			return
+		}
+
+		diagram.Touch()
+		progress <- Progress{ID: shortID, Kind: Started}
+		if err := c.generateAndStore(diagram, progress, shortID); err != nil {
+			progress <- Progress{ID: shortID, Kind: Failed, Err: err}
+			return
+		}
+		progress <- Progress{ID: shortID, Kind: Stored}
+		progress <- Progress{ID: shortID, Kind: Done}
+	}()
+
+	return progress, nil
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProgressEventEncodesEmbeddedNewlinesOnOneLine(t *testing.T) {
+	p := Progress{ID: "abc123", Kind: CLIStderr, Line: "line one\nline two\nline three"}
+
+	data, err := json.Marshal(p.event())
+	if err != nil {
+		t.Fatalf("could not marshal progress event: %s", err)
+	}
+	if strings.Contains(string(data), "\n") {
+		t.Fatalf("progress event JSON must not contain a raw newline (would break SSE framing), got: %q", data)
+	}
+
+	var decoded progressEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("could not unmarshal progress event: %s", err)
+	}
+	if decoded.Line != p.Line {
+		t.Fatalf("round-tripped line = %q, want %q", decoded.Line, p.Line)
+	}
+}
+
+func TestProgressEventIncludesErrString(t *testing.T) {
+	p := Progress{ID: "abc123", Kind: Failed, Err: errors.New("mmdc exited with status 1")}
+
+	ev := p.event()
+	if ev.Err != "mmdc exited with status 1" {
+		t.Fatalf("event.Err = %q, want the wrapped error's message", ev.Err)
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("could not marshal progress event: %s", err)
+	}
+	if strings.Contains(string(data), "\n") {
+		t.Fatalf("progress event JSON must not contain a raw newline, got: %q", data)
+	}
+}
+
+func TestProgressEventOmitsEmptyFields(t *testing.T) {
+	data, err := json.Marshal(Progress{ID: "abc123", Kind: Done}.event())
+	if err != nil {
+		t.Fatalf("could not marshal progress event: %s", err)
+	}
+	if strings.Contains(string(data), `"line"`) || strings.Contains(string(data), `"err"`) {
+		t.Fatalf("expected empty line/err fields to be omitted, got: %s", data)
+	}
+}
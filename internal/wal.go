@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// walOp identifies the kind of state-changing operation a walRecord
+// brackets, modeled on the intent/commit split of an etcd-style WAL.
+type walOp string
+
+const (
+	opIntentGenerate walOp = "intent-generate"
+	opCommitStore    walOp = "commit-store"
+	opIntentDelete   walOp = "intent-delete"
+	opCommitDelete   walOp = "commit-delete"
+)
+
+// walRecord is a single WAL entry.
+type walRecord struct {
+	Op      walOp
+	ID      string
+	InPath  string
+	OutPath string
+}
+
+// walSnapshotThreshold is the number of records after which the WAL is
+// rewritten from the current cache state and truncated.
+const walSnapshotThreshold = 1000
+
+// wal is an append-only, fsync-ed log of in-flight cache operations, kept
+// alongside the cache directory so a crashed process can resume or roll
+// back any operation it left half-done.
+type wal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	records int
+}
+
+// openWAL opens (creating if necessary) the WAL file at path for appending.
+func openWAL(path string) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open wal [%s]: %w", path, err)
+	}
+	return &wal{path: path, f: f}, nil
+}
+
+// append writes rec to the WAL and fsyncs it before returning.
+func (w *wal) append(rec walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("could not marshal wal record: %w", err)
+	}
+	if _, err := w.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not append wal record: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("could not fsync wal: %w", err)
+	}
+	w.records++
+	return nil
+}
+
+// maybeSnapshot rewrites the WAL from the cache's current state and
+// truncates it, once the number of appended records exceeds
+// walSnapshotThreshold.
+func (w *wal) maybeSnapshot(cache DiagramCache) error {
+	w.mu.Lock()
+	full := w.records > walSnapshotThreshold
+	w.mu.Unlock()
+	if !full {
+		return nil
+	}
+
+	diagrams, err := cache.GetAll()
+	if err != nil {
+		return fmt.Errorf("could not get cached diagrams for wal snapshot: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tmpPath := w.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open wal snapshot [%s]: %w", tmpPath, err)
+	}
+	for _, d := range diagrams {
+		id, err := d.ID()
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("cannot get diagram ID: %w", err)
+		}
+		line, err := json.Marshal(walRecord{Op: opCommitStore, ID: id, OutPath: d.Output})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("could not marshal wal snapshot record: %w", err)
+		}
+		if _, err := tmp.Write(append(line, '\n')); err != nil {
+			tmp.Close()
+			return fmt.Errorf("could not write wal snapshot record: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not fsync wal snapshot: %w", err)
+	}
+	tmp.Close()
+
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("could not close wal: %w", err)
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return fmt.Errorf("could not replace wal with snapshot: %w", err)
+	}
+
+	f, err := os.OpenFile(w.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not reopen wal after snapshot: %w", err)
+	}
+	w.f = f
+	w.records = len(diagrams)
+	return nil
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// replayWAL reads the WAL at path and resolves any record whose intent was
+// never followed by a matching commit: a dangling intent-generate is
+// finished (if mmdc had already produced outPath) or rolled back (otherwise),
+// and a dangling intent-delete is finished by removing whatever is left of
+// the diagram. It returns the number of records found, for seeding the WAL's
+// record counter.
+func replayWAL(path string, cache DiagramCache) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not open wal [%s]: %w", path, err)
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("could not read wal: %w", err)
+	}
+
+	pendingGenerate := make(map[string]walRecord)
+	pendingDelete := make(map[string]walRecord)
+	count := len(lines)
+
+	for i, line := range lines {
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if i == len(lines)-1 {
+				// A process can crash mid-append, leaving a torn/partial
+				// record at the very end of the file. Treat it as if the
+				// append never happened rather than failing replay of
+				// every record that came before it; corruption anywhere
+				// but the last line is a sign of a deeper problem and is
+				// still fatal.
+				count--
+				break
+			}
+			return 0, fmt.Errorf("could not parse wal record: %w", err)
+		}
+		switch rec.Op {
+		case opIntentGenerate:
+			pendingGenerate[rec.ID] = rec
+		case opCommitStore:
+			delete(pendingGenerate, rec.ID)
+		case opIntentDelete:
+			pendingDelete[rec.ID] = rec
+		case opCommitDelete:
+			delete(pendingDelete, rec.ID)
+		}
+	}
+
+	for id, rec := range pendingGenerate {
+		if err := finishOrRollbackGenerate(id, rec, cache); err != nil {
+			return 0, err
+		}
+	}
+	for id, rec := range pendingDelete {
+		if err := finishDelete(id, rec, cache); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+// finishOrRollbackGenerate completes an interrupted generate (mmdc ran to
+// completion but the process died before cache.Store) or rolls it back
+// (mmdc never finished, so only an orphaned .mmd input, and possibly a
+// half-written temp output, can exist).
+//
+// This relies on cliRunner implementations always rendering to a temp file
+// and renaming it into place atomically on success (see execRunner.run and
+// mmdc-worker.js), so os.Stat(rec.OutPath) succeeding can only mean the
+// render fully completed, never that it's mid-write.
+func finishOrRollbackGenerate(id string, rec walRecord, cache DiagramCache) error {
+	if _, err := os.Stat(rec.OutPath); err == nil {
+		description, err := ioutil.ReadFile(rec.InPath)
+		if err != nil {
+			return fmt.Errorf("could not read orphaned wal input [%s]: %w", rec.InPath, err)
+		}
+		imgType := strings.TrimPrefix(filepath.Ext(rec.OutPath), ".")
+		diagram := NewDiagram(description, imgType)
+		diagram.Output = rec.OutPath
+		if err := cache.Store(diagram); err != nil {
+			return fmt.Errorf("could not finish interrupted store [%s]: %w", id, err)
+		}
+		return nil
+	}
+
+	if err := os.Remove(rec.InPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not roll back orphaned wal input [%s]: %w", rec.InPath, err)
+	}
+	if err := os.Remove(rec.OutPath + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not roll back orphaned wal temp output [%s]: %w", rec.OutPath+".tmp", err)
+	}
+	return nil
+}
+
+// finishDelete completes an interrupted delete by removing whatever files
+// are still left and dropping the cache entry, matching cachingGenerator.delete.
+func finishDelete(id string, rec walRecord, cache DiagramCache) error {
+	if err := os.Remove(rec.InPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not finish deleting wal input [%s]: %w", rec.InPath, err)
+	}
+	if err := os.Remove(rec.OutPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not finish deleting wal output [%s]: %w", rec.OutPath, err)
+	}
+
+	diagrams, err := cache.GetAll()
+	if err != nil {
+		return fmt.Errorf("could not get cached diagrams: %w", err)
+	}
+	for _, d := range diagrams {
+		dID, err := d.ID()
+		if err != nil {
+			return fmt.Errorf("cannot get diagram ID: %w", err)
+		}
+		if dID == id {
+			if err := cache.Delete(d); err != nil {
+				return fmt.Errorf("could not finish removing diagram from cache [%s]: %w", id, err)
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeCache is a minimal DiagramCache stub for exercising WAL replay without
+// a real cache backend.
+type fakeCache struct {
+	diagrams []*Diagram
+}
+
+func (c *fakeCache) Has(d *Diagram) (bool, error)     { return false, nil }
+func (c *fakeCache) Get(d *Diagram) (*Diagram, error) { return nil, nil }
+func (c *fakeCache) Delete(d *Diagram) error          { return nil }
+func (c *fakeCache) GetAll() ([]*Diagram, error)      { return c.diagrams, nil }
+func (c *fakeCache) Store(d *Diagram) error {
+	c.diagrams = append(c.diagrams, d)
+	return nil
+}
+
+func writeWALLines(t *testing.T, path string, raw string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(raw), 0644); err != nil {
+		t.Fatalf("could not write wal fixture: %s", err)
+	}
+}
+
+func TestReplayWALToleratesTornLastRecord(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "wal.log")
+
+	// A complete intent/commit pair for diagram "a", followed by a second
+	// intent-generate record torn mid-write (no trailing newline, not
+	// valid JSON), as if the process crashed partway through an append.
+	writeWALLines(t, walPath,
+		`{"Op":"intent-generate","ID":"a","InPath":"a.mmd","OutPath":"a.svg"}`+"\n"+
+			`{"Op":"commit-store","ID":"a","InPath":"a.mmd","OutPath":"a.svg"}`+"\n"+
+			`{"Op":"intent-generate","ID":"b","InPath":"b.mmd","OutPat`)
+
+	count, err := replayWAL(walPath, &fakeCache{})
+	if err != nil {
+		t.Fatalf("replayWAL should tolerate a torn trailing record, got: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 complete records, got %d", count)
+	}
+}
+
+func TestReplayWALFailsOnCorruptionBeforeTheLastRecord(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "wal.log")
+
+	writeWALLines(t, walPath,
+		`not json at all`+"\n"+
+			`{"Op":"commit-store","ID":"a","InPath":"a.mmd","OutPath":"a.svg"}`+"\n")
+
+	if _, err := replayWAL(walPath, &fakeCache{}); err == nil {
+		t.Fatal("expected replayWAL to fail on corruption that isn't the torn final record")
+	}
+}
+
+func TestReplayWALMissingFileIsNotAnError(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "missing-wal.log")
+
+	count, err := replayWAL(walPath, &fakeCache{})
+	if err != nil {
+		t.Fatalf("replayWAL on a missing wal should be a no-op, got: %s", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected 0 records, got %d", count)
+	}
+}
+
+func TestReplayWALFinishesDanglingIntentGenerateWhenOutputExists(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "wal.log")
+	inPath := filepath.Join(dir, "a.mmd")
+	outPath := filepath.Join(dir, "a.svg")
+
+	if err := os.WriteFile(inPath, []byte("graph TD; A-->B;"), 0644); err != nil {
+		t.Fatalf("could not write fixture input: %s", err)
+	}
+	if err := os.WriteFile(outPath, []byte("<svg></svg>"), 0644); err != nil {
+		t.Fatalf("could not write fixture output: %s", err)
+	}
+	writeWALLines(t, walPath,
+		`{"Op":"intent-generate","ID":"a","InPath":"`+inPath+`","OutPath":"`+outPath+`"}`+"\n")
+
+	cache := &fakeCache{}
+	if _, err := replayWAL(walPath, cache); err != nil {
+		t.Fatalf("replayWAL failed: %s", err)
+	}
+	if len(cache.diagrams) != 1 {
+		t.Fatalf("expected the interrupted store to be finished into the cache, got %d diagrams", len(cache.diagrams))
+	}
+}
+
+func TestReplayWALRollsBackDanglingIntentGenerateWhenOutputMissing(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "wal.log")
+	inPath := filepath.Join(dir, "a.mmd")
+	outPath := filepath.Join(dir, "a.svg")
+
+	if err := os.WriteFile(inPath, []byte("graph TD; A-->B;"), 0644); err != nil {
+		t.Fatalf("could not write fixture input: %s", err)
+	}
+	writeWALLines(t, walPath,
+		`{"Op":"intent-generate","ID":"a","InPath":"`+inPath+`","OutPath":"`+outPath+`"}`+"\n")
+
+	cache := &fakeCache{}
+	if _, err := replayWAL(walPath, cache); err != nil {
+		t.Fatalf("replayWAL failed: %s", err)
+	}
+	if len(cache.diagrams) != 0 {
+		t.Fatalf("expected no cache entry for a rolled-back generate, got %d diagrams", len(cache.diagrams))
+	}
+	if _, err := os.Stat(inPath); !os.IsNotExist(err) {
+		t.Fatalf("expected orphaned input [%s] to be removed on rollback", inPath)
+	}
+}